@@ -0,0 +1,134 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config holds the subset of TiDB's global configuration that
+// sessionctx/binloginfo depends on. It only covers the binlog-related
+// settings exercised by that package.
+package config
+
+import (
+	"sync/atomic"
+
+	"github.com/pingcap/log"
+)
+
+// Config is TiDB's global configuration.
+type Config struct {
+	Path     string   `toml:"path" json:"path"`
+	Log      Log      `toml:"log" json:"log"`
+	Security Security `toml:"security" json:"security"`
+	Binlog   Binlog   `toml:"binlog" json:"binlog"`
+}
+
+// Log is the logging section of the config.
+type Log struct {
+	Level  string `toml:"level" json:"level"`
+	Format string `toml:"format" json:"format"`
+	File   string `toml:"file" json:"file"`
+}
+
+// ToLogConfig converts Log to the log package's Config.
+func (l Log) ToLogConfig() *log.Config {
+	return &log.Config{Level: l.Level, Format: l.Format, File: log.FileLogConfig{Filename: l.File}}
+}
+
+// Security is the cluster TLS section of the config.
+type Security struct {
+	ClusterSSLCA   string `toml:"cluster-ssl-ca" json:"cluster-ssl-ca"`
+	ClusterSSLCert string `toml:"cluster-ssl-cert" json:"cluster-ssl-cert"`
+	ClusterSSLKey  string `toml:"cluster-ssl-key" json:"cluster-ssl-key"`
+}
+
+// Binlog is the `[binlog]` config section.
+type Binlog struct {
+	Enable       bool   `toml:"enable" json:"enable"`
+	AutoMode     bool   `toml:"auto-mode" json:"auto-mode"`
+	IgnoreError  bool   `toml:"ignore-error" json:"ignore-error"`
+	WriteTimeout string `toml:"write-timeout" json:"write-timeout"`
+	BinlogSocket string `toml:"binlog-socket" json:"binlog-socket"`
+
+	// Sink selects where WriteBinlog sends binlogs. A nil Sink (or an empty
+	// Sink.Type) keeps the historical behavior of writing through Pump.
+	Sink *BinlogSinkConfig `toml:"sink" json:"sink"`
+
+	// MaxPendingBytes caps how many bytes of not-yet-flushed binlog can sit
+	// in the async batching queue (see sessionctx/binloginfo/batch.go)
+	// before backpressure kicks in. Zero/negative falls back to a 64MiB
+	// default.
+	MaxPendingBytes int64 `toml:"max-pending-bytes" json:"max-pending-bytes"`
+	// MaxPendingShed selects what happens once MaxPendingBytes is reached:
+	// true drops the write (and counts it in BinlogDroppedCounter), false
+	// blocks the caller until the queue drains.
+	MaxPendingShed bool `toml:"max-pending-shed" json:"max-pending-shed"`
+
+	// SpoolDir, when set, is where binlogs are written when every Pump node
+	// is unavailable (see sessionctx/binloginfo/spool.go), instead of
+	// failing the write. Empty disables spooling.
+	SpoolDir string `toml:"spool-dir" json:"spool-dir"`
+}
+
+// BinlogSinkConfig is the `[binlog.sink]` config section.
+type BinlogSinkConfig struct {
+	// Type selects the Sink implementation: "pump" (default), "kafka", or
+	// "pulsar".
+	Type string `toml:"type" json:"type"`
+	// TopicTemplate names the destination topic for the kafka/pulsar sinks;
+	// it may reference "{commit_ts}" / "{start_ts}" placeholders.
+	TopicTemplate string             `toml:"topic-template" json:"topic-template"`
+	Kafka         BinlogKafkaConfig  `toml:"kafka" json:"kafka"`
+	Pulsar        BinlogPulsarConfig `toml:"pulsar" json:"pulsar"`
+	TLS           BinlogSinkTLS      `toml:"tls" json:"tls"`
+}
+
+// BinlogKafkaConfig is the `[binlog.sink.kafka]` config section.
+type BinlogKafkaConfig struct {
+	Brokers     []string `toml:"brokers" json:"brokers"`
+	Compression string   `toml:"compression" json:"compression"`
+}
+
+// BinlogPulsarConfig is the `[binlog.sink.pulsar]` config section.
+type BinlogPulsarConfig struct {
+	ServiceURL  string `toml:"service-url" json:"service-url"`
+	Compression string `toml:"compression" json:"compression"`
+}
+
+// BinlogSinkTLS is the `[binlog.sink.tls]` config section. The kafka sink
+// uses all of it; the pulsar sink only reads CAPath.
+type BinlogSinkTLS struct {
+	CAPath   string `toml:"ca-path" json:"ca-path"`
+	CertPath string `toml:"cert-path" json:"cert-path"`
+	KeyPath  string `toml:"key-path" json:"key-path"`
+	SNI      string `toml:"sni" json:"sni"`
+}
+
+var globalConf atomic.Value
+
+func init() {
+	globalConf.Store(NewConfig())
+}
+
+// NewConfig creates a Config with its defaults.
+func NewConfig() *Config {
+	return &Config{}
+}
+
+// GetGlobalConfig returns the global configuration.
+func GetGlobalConfig() *Config {
+	return globalConf.Load().(*Config)
+}
+
+// StoreGlobalConfig stores a new global configuration, replacing the
+// previous one wholesale.
+func StoreGlobalConfig(config *Config) {
+	globalConf.Store(config)
+}
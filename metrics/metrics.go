@@ -0,0 +1,96 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics holds the subset of TiDB's Prometheus metrics that
+// sessionctx/binloginfo depends on.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	// CriticalErrorCounter counts critical errors, e.g. a failed binlog
+	// write whose error was ignored because `binlog.ignore-error` is set.
+	CriticalErrorCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tidb",
+		Subsystem: "server",
+		Name:      "critical_error_total",
+		Help:      "Counter of critical errors.",
+	})
+
+	// BinlogQueueSizeGauge tracks the number of bytes currently queued in
+	// the async binlog batching writer.
+	BinlogQueueSizeGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tidb",
+		Subsystem: "binlog",
+		Name:      "queue_size_bytes",
+		Help:      "Bytes of binlog currently queued for async batch flushing.",
+	})
+
+	// BinlogBatchSizeHistogram tracks the byte size of each flushed batch.
+	BinlogBatchSizeHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "tidb",
+		Subsystem: "binlog",
+		Name:      "batch_size_bytes",
+		Help:      "Size in bytes of each flushed binlog batch.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 2, 12),
+	})
+
+	// BinlogDroppedCounter counts binlogs shed because the async queue was
+	// over `binlog.max-pending-bytes` and `binlog.max-pending-shed` is set.
+	BinlogDroppedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tidb",
+		Subsystem: "binlog",
+		Name:      "dropped_total",
+		Help:      "Binlogs dropped due to a full async batching queue.",
+	})
+
+	// BinlogBackpressureCounter counts writes that had to block because the
+	// async queue was over `binlog.max-pending-bytes`.
+	BinlogBackpressureCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tidb",
+		Subsystem: "binlog",
+		Name:      "backpressure_total",
+		Help:      "Writes blocked by binlog async queue backpressure.",
+	})
+
+	// BinlogBreakerStateGauge tracks each Pump node's circuit breaker state
+	// (0=closed, 1=half_open, 2=open).
+	BinlogBreakerStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tidb",
+		Subsystem: "binlog",
+		Name:      "breaker_state",
+		Help:      "Circuit breaker state per Pump node (0=closed, 1=half_open, 2=open).",
+	}, []string{"node"})
+
+	// BinlogSpoolLagGauge tracks how many binlogs are sitting in the local
+	// WAL spool, waiting to be replayed to Pump.
+	BinlogSpoolLagGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tidb",
+		Subsystem: "binlog",
+		Name:      "spool_lag_rows",
+		Help:      "Binlogs currently sitting in the local spool, waiting to be replayed.",
+	})
+)
+
+// RegisterMetrics registers the metrics defined in this package with the
+// default Prometheus registry. It panics if the metrics are already
+// registered, so it can be called only once per process.
+func RegisterMetrics() {
+	prometheus.MustRegister(CriticalErrorCounter)
+	prometheus.MustRegister(BinlogQueueSizeGauge)
+	prometheus.MustRegister(BinlogBatchSizeHistogram)
+	prometheus.MustRegister(BinlogDroppedCounter)
+	prometheus.MustRegister(BinlogBackpressureCounter)
+	prometheus.MustRegister(BinlogBreakerStateGauge)
+	prometheus.MustRegister(BinlogSpoolLagGauge)
+}
@@ -0,0 +1,186 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binloginfo
+
+import (
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/config"
+	"github.com/pingcap/tidb/metrics"
+	"github.com/pingcap/tipb/go-binlog"
+)
+
+// batchFlushSize bounds how many bytes a worker accumulates from the queue
+// before flushing, so one very busy worker can't hold binlogs indefinitely.
+const (
+	batchFlushSize   = 256 * 1024
+	batchWorkerCount = 4
+)
+
+// pendingBinlog is one queued WriteBinlog call waiting to be flushed; done
+// is the "future" WriteBinlog blocks on.
+type pendingBinlog struct {
+	sink Sink
+	data *binlog.Binlog
+	size int
+	done chan error
+}
+
+// asyncWriter is the bounded ring buffer plus worker pool that batches
+// WriteBinlog calls before flushing them to a Sink. It is shared by all
+// sessions on this TiDB instance. pendingBytes is guarded by spaceMu rather
+// than accessed atomically, because admission (reserveSpace) has to check
+// and update it as one step -- a separate load-then-add lets two callers
+// both observe room for size bytes and both admit, overshooting maxPending.
+type asyncWriter struct {
+	queue        chan *pendingBinlog
+	pendingBytes int64
+	maxPending   int64
+
+	startOnce sync.Once
+	spaceMu   sync.Mutex
+	spaceCond *sync.Cond
+}
+
+var defaultAsyncWriter = &asyncWriter{}
+
+// ensureStarted lazily sizes the queue from the current config and starts the
+// worker pool. It is safe to call repeatedly.
+func (w *asyncWriter) ensureStarted() {
+	w.startOnce.Do(func() {
+		w.maxPending = config.GetGlobalConfig().Binlog.MaxPendingBytes
+		if w.maxPending <= 0 {
+			w.maxPending = 64 * 1024 * 1024
+		}
+		w.spaceCond = sync.NewCond(&w.spaceMu)
+		// The channel itself is sized generously; actual backpressure is
+		// enforced on byte count via pendingBytes, not slot count.
+		w.queue = make(chan *pendingBinlog, 4096)
+		for i := 0; i < batchWorkerCount; i++ {
+			go w.runWorker()
+		}
+	})
+}
+
+// enqueue admits bl for async flushing and blocks until it (or its batch)
+// has been written, mirroring the synchronous contract WriteBinlog used to
+// have. When the queue is over `binlog.max-pending-bytes`, it either sheds
+// the write or blocks the caller until the queue drains below the limit,
+// depending on config.Binlog.MaxPendingShed.
+func (w *asyncWriter) enqueue(sink Sink, bl *binlog.Binlog) error {
+	w.ensureStarted()
+
+	size := bl.Size()
+	if err := w.reserveSpace(size); err != nil {
+		return err
+	}
+
+	p := &pendingBinlog{sink: sink, data: bl, size: size, done: make(chan error, 1)}
+	w.queue <- p
+	return <-p.done
+}
+
+// reserveSpace accounts size bytes against maxPending, either shedding the
+// write or blocking the caller until space frees up. The check against
+// maxPending and the addition to pendingBytes happen under the same
+// critical section, so two concurrent callers can't both observe room for
+// size bytes and both admit -- admission and accounting have to be one
+// atomic step, not load-then-add.
+func (w *asyncWriter) reserveSpace(size int) error {
+	w.spaceMu.Lock()
+
+	if w.pendingBytes+int64(size) <= w.maxPending {
+		w.pendingBytes += int64(size)
+		w.spaceMu.Unlock()
+		metrics.BinlogQueueSizeGauge.Set(float64(w.pendingBytes))
+		return nil
+	}
+
+	if config.GetGlobalConfig().Binlog.MaxPendingShed {
+		w.spaceMu.Unlock()
+		metrics.BinlogDroppedCounter.Inc()
+		return errors.New("binlog: write queue is over max_pending_bytes, binlog dropped")
+	}
+
+	metrics.BinlogBackpressureCounter.Inc()
+	for w.pendingBytes+int64(size) > w.maxPending {
+		w.spaceCond.Wait()
+	}
+	w.pendingBytes += int64(size)
+	w.spaceMu.Unlock()
+	metrics.BinlogQueueSizeGauge.Set(float64(w.pendingBytes))
+	return nil
+}
+
+// release frees size bytes back to the pending-bytes budget and wakes any
+// writer blocked in reserveSpace.
+func (w *asyncWriter) release(size int) {
+	w.spaceMu.Lock()
+	w.pendingBytes -= int64(size)
+	metrics.BinlogQueueSizeGauge.Set(float64(w.pendingBytes))
+	w.spaceCond.Broadcast()
+	w.spaceMu.Unlock()
+}
+
+// runWorker pulls pending binlogs off the queue and flushes them as a batch:
+// it blocks for the first one, then opportunistically drains whatever else
+// is already queued (up to batchFlushSize bytes) without waiting for more to
+// arrive, so a lone write is never held up waiting for company.
+func (w *asyncWriter) runWorker() {
+	for {
+		first, ok := <-w.queue
+		if !ok {
+			return
+		}
+
+		batch := []*pendingBinlog{first}
+		batchBytes := first.size
+	collect:
+		for batchBytes < batchFlushSize {
+			select {
+			case p, ok := <-w.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, p)
+				batchBytes += p.size
+			default:
+				break collect
+			}
+		}
+
+		w.flush(batch, batchBytes)
+	}
+}
+
+// flush writes every binlog in batch to its sink concurrently, so the batch's
+// wall-clock cost is that of the slowest write rather than their sum, and
+// resolves each write's future as soon as its own write completes.
+func (w *asyncWriter) flush(batch []*pendingBinlog, batchBytes int) {
+	metrics.BinlogBatchSizeHistogram.Observe(float64(batchBytes))
+
+	var wg sync.WaitGroup
+	wg.Add(len(batch))
+	for _, p := range batch {
+		p := p
+		go func() {
+			defer wg.Done()
+			err := p.sink.WriteBinlog(p.data)
+			p.done <- err
+			w.release(p.size)
+		}()
+	}
+	wg.Wait()
+}
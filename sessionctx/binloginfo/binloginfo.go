@@ -47,8 +47,17 @@ var pumpsClientLock sync.RWMutex
 
 // BinlogInfo contains binlog data and binlog client.
 type BinlogInfo struct {
-	Data   *binlog.Binlog
+	Data *binlog.Binlog
+	// Client is the PumpsClient this binlog was prepared against (see
+	// SetDDLBinlog). WriteBinlog uses it to build the process-wide pump
+	// sink the first time one is needed; once that sink exists it's reused
+	// by every BinlogInfo regardless of Client, the same way pumpsClient
+	// itself is a single shared instance rather than one per caller.
 	Client *pumpcli.PumpsClient
+	// Sink, when set, receives the binlog instead of going through Client.
+	// It lets WriteBinlog target a pluggable destination (Kafka, Pulsar,
+	// ...) selected by the `[binlog].sink` config, defaulting to Pump.
+	Sink Sink
 }
 
 // GetPumpsClient get the pumps client instance.
@@ -120,6 +129,76 @@ func CreatePumpsClient() (*pumpcli.PumpsClient, error) {
 	return client, err
 }
 
+// CreateSink creates the configured binlog Sink (pump, kafka, or pulsar),
+// falling back to the Pump-backed sink when `[binlog].sink` is unset so
+// existing deployments are unaffected.
+func CreateSink() (Sink, error) {
+	return CreateSinkWithClient(nil)
+}
+
+// CreateSinkWithClient is like CreateSink, but when the configured sink type
+// is (or defaults to) "pump", it builds that sink around client instead of
+// grabbing GetOrCreatePumpsClient()'s instance -- so a pump sink built here
+// actually uses the PumpsClient the caller (e.g. BinlogInfo.Client) resolved
+// for it. A nil client falls back to GetOrCreatePumpsClient(), same as
+// CreateSink. Other sink types ignore client entirely.
+func CreateSinkWithClient(client *pumpcli.PumpsClient) (Sink, error) {
+	cfg := config.GetGlobalConfig().Binlog.Sink
+	if client == nil || (cfg != nil && cfg.Type != "" && cfg.Type != "pump") {
+		return NewSink(cfg)
+	}
+	return newPumpSinkWithClient(client)
+}
+
+// sink is the process-wide Sink every BinlogInfo falls back to, opened once
+// on first use and never closed, mirroring pumpsClient/pumpsClientLock
+// above. Without this, each BinlogInfo (one per transaction, see
+// SetDDLBinlog) would build its own Sink, and a pump sink's WAL spool file
+// would then have several independent *os.File handles appending to the
+// same path -- leaking file descriptors and letting their writes interleave
+// and corrupt the length-prefixed framing.
+var sink Sink
+var sinkLock sync.RWMutex
+
+// GetSink gets the process-wide sink instance, or nil if none has been
+// created yet.
+func GetSink() Sink {
+	sinkLock.RLock()
+	s := sink
+	sinkLock.RUnlock()
+	return s
+}
+
+// SetSink sets the process-wide sink instance.
+func SetSink(s Sink) {
+	sinkLock.Lock()
+	sink = s
+	sinkLock.Unlock()
+}
+
+// GetOrCreateSink gets the process-wide sink instance, creating it from
+// client and the current config on first use. client is only consulted on
+// that first call; once the sink exists, later calls return it unchanged
+// regardless of client, the same way GetOrCreatePumpsClient ignores repeat
+// callers once pumpsClient is set.
+func GetOrCreateSink(client *pumpcli.PumpsClient) (Sink, error) {
+	if s := GetSink(); s != nil {
+		return s, nil
+	}
+
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+	if sink != nil {
+		return sink, nil
+	}
+	s, err := CreateSinkWithClient(client)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	sink = s
+	return sink, nil
+}
+
 // SetPumpsClient sets the pumps client instance.
 func SetPumpsClient(client *pumpcli.PumpsClient) {
 	pumpsClientLock.Lock()
@@ -139,13 +218,19 @@ func GetPrewriteValue(ctx sessionctx.Context, createIfNotExists bool) *binlog.Pr
 	return v
 }
 
-var skipBinlog uint32
 var ignoreError uint32
 
-// DisableSkipBinlogFlag disable the skipBinlog flag.
+// DisableSkipBinlogFlag closes every Pump node's circuit breaker, so writes
+// are sent to Pump again rather than spooled; while binlogs from an earlier
+// outage are still waiting in the spool, new writes keep going to the spool.
+// It is kept for compatibility with the old skipBinlog flag it replaces.
 func DisableSkipBinlogFlag() {
-	atomic.StoreUint32(&skipBinlog, 0)
-	log.Warn("[binloginfo] disable the skipBinlog flag")
+	breakerRegistryLock.Lock()
+	for _, cb := range breakerRegistry {
+		cb.RecordSuccess()
+	}
+	breakerRegistryLock.Unlock()
+	log.Warn("[binloginfo] reset all pump circuit breakers to closed")
 }
 
 // SetIgnoreError sets the ignoreError flag, this function called when TiDB start
@@ -167,27 +252,34 @@ func ShouldEnableBinlog() bool {
 	return config.GetGlobalConfig().Binlog.Enable
 }
 
-// WriteBinlog writes a binlog to Pump.
+// WriteBinlog writes a binlog to the configured sink (Pump by default). With
+// the pump sink, a Pump node that keeps failing trips its circuit breaker
+// (see breaker.go); once every node is open and `binlog.spool-dir` is set,
+// writes are spooled locally instead of sent to Pump. Without a spool dir
+// they are still sent to Pump.
 func (info *BinlogInfo) WriteBinlog(clusterID uint64) error {
-	skip := atomic.LoadUint32(&skipBinlog)
-	if skip > 0 {
-		metrics.CriticalErrorCounter.Add(1)
-		return nil
-	}
-
-	if info.Client == nil {
-		return errors.New("pumps client is nil")
+	if info.Sink == nil {
+		// GetOrCreateSink honors `[binlog].sink.type` and is shared by every
+		// BinlogInfo (one per transaction, see SetDDLBinlog) so a pump
+		// sink's WAL spool is only ever opened once; info.Client seeds that
+		// first construction when the pump sink is the one being built.
+		sink, err := GetOrCreateSink(info.Client)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		info.Sink = sink
 	}
 
-	// it will retry in PumpsClient if write binlog fail.
-	err := info.Client.WriteBinlog(info.Data)
+	// The write is queued on defaultAsyncWriter, which batches it with other
+	// concurrent writes before flushing to the sink; for the pump sink,
+	// PumpsClient retries a failed write. We still block here so commit paths
+	// observe the outcome synchronously.
+	err := defaultAsyncWriter.enqueue(info.Sink, info.Data)
 	if err != nil {
 		log.Errorf("write binlog fail %v", errors.ErrorStack(err))
 		if atomic.LoadUint32(&ignoreError) == 1 {
 			log.Error("write binlog fail but error ignored")
 			metrics.CriticalErrorCounter.Add(1)
-			// If error happens once, we'll stop writing binlog.
-			atomic.CompareAndSwapUint32(&skipBinlog, skip, skip+1)
 			return nil
 		}
 
@@ -0,0 +1,235 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binloginfo
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/tidb-tools/tidb-binlog/node"
+	pumpcli "github.com/pingcap/tidb-tools/tidb-binlog/pump_client"
+	"github.com/pingcap/tidb/metrics"
+)
+
+type breakerState int32
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "open"
+	}
+}
+
+const (
+	// breakerFailureThreshold is set well above the "one bad node" case on
+	// purpose -- see the circuitBreaker doc comment below for why a low
+	// threshold here would trip every node's breaker off a single flaky
+	// node's failures, not just that node's.
+	breakerFailureThreshold = 12
+	breakerBaseBackoff      = 500 * time.Millisecond
+	breakerMaxBackoff       = time.Minute
+	healthCheckInterval     = 2 * time.Second
+)
+
+// circuitBreaker tracks the health of a single Pump node. It starts closed,
+// trips to open after breakerFailureThreshold consecutive failures, and
+// probes recovery through a half-open state with exponentially growing
+// backoff between probes.
+//
+// PumpsClient.WriteBinlog does not report which node actually served a
+// write (see pumpSink.recordOutcome), so there is currently no way to route
+// a write away from one bad node while others stay healthy -- every node's
+// breaker is updated with the same verdict and they trip/recover in
+// lockstep. That means a single consistently-failing node can trip every
+// node's breaker, not just its own, which is why breakerFailureThreshold is
+// set high enough to tolerate a run of failures without spooling writes
+// that healthy nodes could still have served; it's a mitigation; it does
+// not make the per-node state meaningfully independent. The per-node state
+// is real and exported via BinlogBreakerStateGauge, but the only behavior
+// it currently drives is the degenerate allPumpsOpen case: once every node
+// is open, writes are spooled instead of sent to Pump. Per-node routing
+// needs pump_client to expose which node served (or rejected) each write.
+type circuitBreaker struct {
+	nodeID string
+
+	mu            sync.Mutex
+	state         breakerState
+	failures      int32
+	openedAt      time.Time
+	backoff       time.Duration
+	probeInFlight bool
+}
+
+func newCircuitBreaker(nodeID string) *circuitBreaker {
+	return &circuitBreaker{nodeID: nodeID, state: breakerClosed, backoff: breakerBaseBackoff}
+}
+
+// Allow reports whether a write to this node should be attempted now. In the
+// open state it periodically lets exactly one probe through once the
+// backoff has elapsed, moving the breaker to half-open for that attempt.
+func (cb *circuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case breakerClosed:
+		return true
+	case breakerHalfOpen:
+		return !cb.probeInFlight
+	default: // breakerOpen
+		if time.Since(cb.openedAt) < cb.backoff {
+			return false
+		}
+		cb.state = breakerHalfOpen
+		cb.probeInFlight = true
+		metrics.BinlogBreakerStateGauge.WithLabelValues(cb.nodeID).Set(float64(breakerHalfOpen))
+		return true
+	}
+}
+
+// RecordSuccess closes the breaker and resets its backoff.
+func (cb *circuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.state = breakerClosed
+	cb.failures = 0
+	cb.backoff = breakerBaseBackoff
+	cb.probeInFlight = false
+	metrics.BinlogBreakerStateGauge.WithLabelValues(cb.nodeID).Set(float64(breakerClosed))
+}
+
+// RecordFailure counts a failed write and trips the breaker open once
+// breakerFailureThreshold consecutive failures are seen, doubling the
+// backoff each time a half-open probe itself fails.
+func (cb *circuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == breakerHalfOpen {
+		cb.probeInFlight = false
+		cb.backoff *= 2
+		if cb.backoff > breakerMaxBackoff {
+			cb.backoff = breakerMaxBackoff
+		}
+		cb.trip()
+		return
+	}
+
+	cb.failures++
+	if cb.state == breakerClosed && cb.failures >= breakerFailureThreshold {
+		cb.trip()
+	}
+}
+
+// trip must be called with cb.mu held.
+func (cb *circuitBreaker) trip() {
+	cb.state = breakerOpen
+	cb.openedAt = time.Now()
+	metrics.BinlogBreakerStateGauge.WithLabelValues(cb.nodeID).Set(float64(breakerOpen))
+}
+
+func (cb *circuitBreaker) State() breakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+var (
+	breakerRegistryLock sync.Mutex
+	breakerRegistry     = map[string]*circuitBreaker{}
+)
+
+// getOrCreateBreaker returns the breaker for nodeID, creating a closed one
+// on first use.
+func getOrCreateBreaker(nodeID string) *circuitBreaker {
+	breakerRegistryLock.Lock()
+	defer breakerRegistryLock.Unlock()
+	cb, ok := breakerRegistry[nodeID]
+	if !ok {
+		cb = newCircuitBreaker(nodeID)
+		breakerRegistry[nodeID] = cb
+	}
+	return cb
+}
+
+// allPumpsOpen reports whether every currently known Pump node is unusable
+// right now, meaning a write has nowhere healthy to land and should be
+// spooled instead. A node counts as usable if either its breaker currently
+// Allow()s a write (closed, or its backoff has elapsed and it's due for a
+// half-open recovery probe) or pumpsClient itself reports it online --
+// pumpsClient can flag a node unavailable faster than its breaker trips
+// (e.g. right after startup, before any write has been attempted against
+// it), so a closed-but-reportedly-unavailable node is still treated as
+// usable here rather than waiting out breakerFailureThreshold failures.
+//
+// Calling Allow() here is itself the recovery probe: when allPumpsOpen
+// returns false because some node's backoff just elapsed, pumpSink goes on
+// to call client.WriteBinlog, and its outcome is what actually resolves
+// that node's half-open state (see recordOutcome).
+func allPumpsOpen(client *pumpcli.PumpsClient) bool {
+	if client == nil || client.Pumps == nil || len(client.Pumps.Pumps) == 0 {
+		return false
+	}
+	for id, pump := range client.Pumps.Pumps {
+		cb := getOrCreateBreaker(id)
+		if cb.Allow() || pump.Status.State == node.Online {
+			return false
+		}
+	}
+	return true
+}
+
+// startHealthChecker polls each Pump node's advertised status on a timer and
+// closes its breaker as soon as the node reports itself online again,
+// letting recovery happen faster than waiting out an open breaker's
+// backoff alone.
+func startHealthChecker(client *pumpcli.PumpsClient) {
+	ticker := time.NewTicker(healthCheckInterval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			if client == nil || client.Pumps == nil {
+				continue
+			}
+			for id, pump := range client.Pumps.Pumps {
+				cb := getOrCreateBreaker(id)
+				if pump.Status.State == node.Online && cb.State() == breakerOpen {
+					cb.RecordSuccess()
+				}
+			}
+		}
+	}()
+}
+
+var healthCheckerStarted int32
+
+// ensureHealthChecker starts the health-check loop for client at most once
+// per process.
+func ensureHealthChecker(client *pumpcli.PumpsClient) {
+	if atomic.CompareAndSwapInt32(&healthCheckerStarted, 0, 1) {
+		startHealthChecker(client)
+	}
+}
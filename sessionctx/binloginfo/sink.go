@@ -0,0 +1,384 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binloginfo
+
+import (
+	"crypto/tls"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/pingcap/errors"
+	pumpcli "github.com/pingcap/tidb-tools/tidb-binlog/pump_client"
+	"github.com/pingcap/tidb/config"
+	"github.com/pingcap/tidb/util"
+	"github.com/pingcap/tipb/go-binlog"
+	log "github.com/sirupsen/logrus"
+)
+
+// buildSinkTLSConfig turns the `[binlog].sink.tls` options into a *tls.Config
+// for the Kafka producer. The Pulsar sink does not use it: it only reads
+// ca-path, as its trust-certs file, and ignores cert-path, key-path and sni.
+func buildSinkTLSConfig(cfg *config.BinlogSinkTLS) (*tls.Config, error) {
+	tlsCfg, err := util.ToTLSConfig(cfg.CAPath, cfg.CertPath, cfg.KeyPath)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if cfg.SNI != "" {
+		tlsCfg.ServerName = cfg.SNI
+	}
+	return tlsCfg, nil
+}
+
+// Sink abstracts the destination a TiDB binlog is written to. The built-in
+// "pump" implementation forwards to drainer via PumpsClient; "kafka" and
+// "pulsar" let operators stream binlogs straight to a message queue so CDC
+// consumers can subscribe without running drainer.
+type Sink interface {
+	// WriteBinlog writes one binlog record to the sink.
+	WriteBinlog(bl *binlog.Binlog) error
+	// Close releases any resources held by the sink.
+	Close() error
+}
+
+// SinkFactory builds a Sink from the global binlog sink configuration.
+type SinkFactory func(cfg *config.BinlogSinkConfig) (Sink, error)
+
+var (
+	sinkFactoriesLock sync.RWMutex
+	sinkFactories     = map[string]SinkFactory{}
+)
+
+// RegisterSink registers a Sink implementation under name, so it can be
+// selected via the `[binlog].sink.type` config option. It is expected to be
+// called from package init functions.
+func RegisterSink(name string, factory SinkFactory) {
+	sinkFactoriesLock.Lock()
+	defer sinkFactoriesLock.Unlock()
+	sinkFactories[name] = factory
+}
+
+func init() {
+	RegisterSink("pump", newPumpSink)
+	RegisterSink("kafka", newKafkaSink)
+	RegisterSink("pulsar", newPulsarSink)
+}
+
+// NewSink creates a Sink according to cfg.Type, defaulting to "pump" when cfg
+// is nil or cfg.Type is empty so existing deployments keep writing to Pump.
+func NewSink(cfg *config.BinlogSinkConfig) (Sink, error) {
+	typ := "pump"
+	if cfg != nil && cfg.Type != "" {
+		typ = cfg.Type
+	}
+
+	sinkFactoriesLock.RLock()
+	factory, ok := sinkFactories[typ]
+	sinkFactoriesLock.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("binlog: unknown sink type %q", typ)
+	}
+	return factory(cfg)
+}
+
+// pumpSink is the default Sink, it forwards writes to a PumpsClient which
+// load-balances across the Pump cluster and handles retries. Each Pump node
+// is guarded by its own circuit breaker; when `binlog.spool-dir` is set and
+// every node's breaker is open, writes are spooled to a local WAL instead of
+// failing outright, and replayed once a node is usable again. Without a
+// spool dir, writes always go to PumpsClient.
+type pumpSink struct {
+	client *pumpcli.PumpsClient
+	spool  *spool
+}
+
+func newPumpSink(_ *config.BinlogSinkConfig) (Sink, error) {
+	// Reuse the process-wide PumpsClient (the same one GetPumpsClient
+	// returns) instead of dialing a redundant one.
+	client := GetOrCreatePumpsClient()
+	if client == nil {
+		return nil, errors.New("binlog: failed to create pumps client")
+	}
+	return newPumpSinkWithClient(client)
+}
+
+func newPumpSinkWithClient(client *pumpcli.PumpsClient) (*pumpSink, error) {
+	ensureHealthChecker(client)
+
+	s := &pumpSink{client: client}
+	if dir := config.GetGlobalConfig().Binlog.SpoolDir; dir != "" {
+		sp, err := newSpool(dir)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		s.spool = sp
+		startSpoolReplayer(s)
+	}
+	return s, nil
+}
+
+func (s *pumpSink) WriteBinlog(bl *binlog.Binlog) error {
+	if s.spool != nil && (s.spool.HasPending() || allPumpsOpen(s.client)) {
+		// Either pumps still look unreachable, or an earlier outage left
+		// binlogs spooled that haven't replayed yet: keep appending to the
+		// spool so bl isn't written ahead of them out of order. The
+		// background replayer (see startSpoolReplayer) drains the backlog
+		// and lets writes resume going straight to Pump once it's empty.
+		return s.spool.Write(bl)
+	}
+
+	err := s.client.WriteBinlog(bl)
+	s.recordOutcome(err)
+	return err
+}
+
+// startSpoolReplayer periodically tries to drain s's spool once Pump looks
+// reachable again. It runs for the lifetime of the process, independent of
+// any single WriteBinlog call, so replay never races with (and reorders
+// against) a write that's in flight on s.
+func startSpoolReplayer(s *pumpSink) {
+	ticker := time.NewTicker(healthCheckInterval)
+	go func() {
+		defer ticker.Stop()
+		plainPump := &pumpSink{client: s.client}
+		for range ticker.C {
+			if !s.spool.HasPending() || allPumpsOpen(s.client) {
+				continue
+			}
+			if err := s.spool.Replay(plainPump); err != nil {
+				log.Warnf("[binloginfo] failed to replay spooled binlogs: %v", err)
+			}
+		}
+	}()
+}
+
+// recordOutcome updates every known Pump node's breaker. PumpsClient does
+// not report which node actually served a write, so each success or failure
+// is recorded against every node in client.Pumps.Pumps, whether or not that
+// node is currently available.
+func (s *pumpSink) recordOutcome(err error) {
+	if s.client == nil || s.client.Pumps == nil {
+		return
+	}
+	for id := range s.client.Pumps.Pumps {
+		cb := getOrCreateBreaker(id)
+		if err == nil {
+			cb.RecordSuccess()
+		} else {
+			cb.RecordFailure()
+		}
+	}
+}
+
+func (s *pumpSink) Close() error {
+	s.client.Close()
+	if s.spool != nil {
+		return s.spool.Close()
+	}
+	return nil
+}
+
+// sinkTopic renders the `[binlog].sink.topic-template` option, resolving the
+// "{commit_ts}" and "{start_ts}" placeholders for every binlog, DDL or DML.
+// There is no table-name placeholder: a binlog carries no table name (a
+// schema change can touch several tables at once).
+func sinkTopic(template string, bl *binlog.Binlog) string {
+	if !strings.Contains(template, "{") {
+		return template
+	}
+	return strings.NewReplacer(
+		"{commit_ts}", strconv.FormatInt(bl.CommitTs, 10),
+		"{start_ts}", strconv.FormatInt(bl.StartTs, 10),
+	).Replace(template)
+}
+
+// kafkaSink streams binlogs to a Kafka topic using sarama. Each message is
+// keyed by the binlog's PrewriteKey and placed by sarama's hash partitioner,
+// so binlogs with the same PrewriteKey land on the same partition. There is
+// no per-table partitioning, and the partitioning scheme is not configurable.
+type kafkaSink struct {
+	producer sarama.SyncProducer
+	topicTpl string
+	cfg      *config.BinlogSinkConfig
+}
+
+func newKafkaSink(cfg *config.BinlogSinkConfig) (Sink, error) {
+	if cfg == nil || len(cfg.Kafka.Brokers) == 0 {
+		return nil, errors.New("binlog: kafka sink requires at least one broker")
+	}
+
+	saramaCfg := sarama.NewConfig()
+	saramaCfg.Producer.Return.Successes = true
+	saramaCfg.Producer.RequiredAcks = sarama.WaitForAll
+	saramaCfg.Producer.Partitioner = sarama.NewHashPartitioner
+	if cfg.Kafka.Compression != "" {
+		codec, err := parseKafkaCompression(cfg.Kafka.Compression)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		saramaCfg.Producer.Compression = codec
+	}
+	if cfg.TLS.CertPath != "" || cfg.TLS.KeyPath != "" || cfg.TLS.CAPath != "" {
+		tlsCfg, err := buildSinkTLSConfig(&cfg.TLS)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		saramaCfg.Net.TLS.Enable = true
+		saramaCfg.Net.TLS.Config = tlsCfg
+	}
+
+	producer, err := sarama.NewSyncProducer(cfg.Kafka.Brokers, saramaCfg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &kafkaSink{producer: producer, topicTpl: cfg.TopicTemplate, cfg: cfg}, nil
+}
+
+func (s *kafkaSink) WriteBinlog(bl *binlog.Binlog) error {
+	data, err := bl.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	msg := &sarama.ProducerMessage{
+		Topic: sinkTopic(s.topicTpl, bl),
+		Key:   sarama.ByteEncoder(bl.PrewriteKey),
+		Value: sarama.ByteEncoder(data),
+	}
+	_, _, err = s.producer.SendMessage(msg)
+	return errors.Trace(err)
+}
+
+func (s *kafkaSink) Close() error {
+	return s.producer.Close()
+}
+
+func parseKafkaCompression(name string) (sarama.CompressionCodec, error) {
+	switch strings.ToLower(name) {
+	case "none", "":
+		return sarama.CompressionNone, nil
+	case "gzip":
+		return sarama.CompressionGZIP, nil
+	case "snappy":
+		return sarama.CompressionSnappy, nil
+	case "lz4":
+		return sarama.CompressionLZ4, nil
+	case "zstd":
+		return sarama.CompressionZSTD, nil
+	default:
+		return sarama.CompressionNone, errors.Errorf("binlog: unknown kafka compression %q", name)
+	}
+}
+
+// pulsarSink streams binlogs to a Pulsar topic. Unlike sarama, pulsar.Client
+// binds one Producer to one topic at creation time rather than taking the
+// topic per message, so when topicTpl has placeholders (see sinkTopic) a
+// producer is created lazily per resolved topic name and cached, instead of
+// pointing a single producer at the literal, unresolved template string.
+type pulsarSink struct {
+	client   pulsar.Client
+	cfg      *config.BinlogSinkConfig
+	topicTpl string
+
+	producersMu sync.Mutex
+	producers   map[string]pulsar.Producer
+}
+
+func newPulsarSink(cfg *config.BinlogSinkConfig) (Sink, error) {
+	if cfg == nil || cfg.Pulsar.ServiceURL == "" {
+		return nil, errors.New("binlog: pulsar sink requires a service URL")
+	}
+
+	clientOpts := pulsar.ClientOptions{URL: cfg.Pulsar.ServiceURL}
+	if cfg.TLS.CAPath != "" {
+		clientOpts.TLSTrustCertsFilePath = cfg.TLS.CAPath
+	}
+	client, err := pulsar.NewClient(clientOpts)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &pulsarSink{
+		client:    client,
+		cfg:       cfg,
+		topicTpl:  cfg.TopicTemplate,
+		producers: make(map[string]pulsar.Producer),
+	}, nil
+}
+
+// producerFor returns the cached Producer for topic, creating one on first
+// use.
+func (s *pulsarSink) producerFor(topic string) (pulsar.Producer, error) {
+	s.producersMu.Lock()
+	defer s.producersMu.Unlock()
+
+	if p, ok := s.producers[topic]; ok {
+		return p, nil
+	}
+	p, err := s.client.CreateProducer(pulsar.ProducerOptions{
+		Topic:           topic,
+		CompressionType: parsePulsarCompression(s.cfg.Pulsar.Compression),
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s.producers[topic] = p
+	return p, nil
+}
+
+func (s *pulsarSink) WriteBinlog(bl *binlog.Binlog) error {
+	data, err := bl.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	producer, err := s.producerFor(sinkTopic(s.topicTpl, bl))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// Key groups messages for Pulsar's key-shared subscriptions, so it
+	// should identify what the write touches (mirroring the Kafka sink's
+	// use of PrewriteKey as the partition key), not the resolved topic
+	// string, which is already the routing target.
+	_, err = producer.Send(nil, &pulsar.ProducerMessage{
+		Payload: data,
+		Key:     string(bl.PrewriteKey),
+	})
+	return errors.Trace(err)
+}
+
+func (s *pulsarSink) Close() error {
+	s.producersMu.Lock()
+	for _, p := range s.producers {
+		p.Close()
+	}
+	s.producersMu.Unlock()
+	s.client.Close()
+	return nil
+}
+
+func parsePulsarCompression(name string) pulsar.CompressionType {
+	switch strings.ToLower(name) {
+	case "lz4":
+		return pulsar.LZ4
+	case "zlib":
+		return pulsar.ZLib
+	case "zstd":
+		return pulsar.ZSTD
+	default:
+		return pulsar.NoCompression
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binloginfo
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/metrics"
+	"github.com/pingcap/tipb/go-binlog"
+)
+
+const spoolFileName = "binlog.wal"
+
+// spool is a local write-ahead file used to hold binlogs while every Pump
+// node is unavailable, so a transient outage doesn't force a choice between
+// blocking the server and dropping data. Records are length-prefixed
+// protobuf messages appended sequentially; Replay drains them in order once
+// a Sink becomes healthy again.
+type spool struct {
+	mu      sync.Mutex
+	dir     string
+	file    *os.File
+	lagRows int64
+}
+
+func newSpool(dir string) (*spool, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, errors.Trace(err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, spoolFileName), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s := &spool{dir: dir, file: f}
+	// Records left in the file by an earlier process are still pending.
+	var lenBuf [4]byte
+	for {
+		if _, err := io.ReadFull(f, lenBuf[:]); err != nil {
+			break
+		}
+		if _, err := f.Seek(int64(binary.BigEndian.Uint32(lenBuf[:])), io.SeekCurrent); err != nil {
+			break
+		}
+		s.lagRows++
+	}
+	metrics.BinlogSpoolLagGauge.Set(float64(s.lagRows))
+	return s, nil
+}
+
+// HasPending reports whether the spool still holds binlogs that haven't
+// been replayed yet.
+func (s *spool) HasPending() bool {
+	return atomic.LoadInt64(&s.lagRows) > 0
+}
+
+// Close closes the underlying spool file.
+func (s *spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Write appends bl to the spool file.
+func (s *spool) Write(bl *binlog.Binlog) error {
+	data, err := bl.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(data)))
+	if _, err := s.file.Write(lenBuf[:]); err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := s.file.Write(data); err != nil {
+		return errors.Trace(err)
+	}
+	atomic.AddInt64(&s.lagRows, 1)
+	metrics.BinlogSpoolLagGauge.Set(float64(atomic.LoadInt64(&s.lagRows)))
+	return nil
+}
+
+// Replay reads every spooled binlog in order and writes it to sink. It stops
+// at the first failure, truncating only the prefix that was successfully
+// replayed so the rest is retried on the next call.
+func (s *spool) Replay(sink Sink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+
+	replayed := 0
+	var offset int64
+	var replayErr error
+	for {
+		var lenBuf [4]byte
+		n, err := io.ReadFull(s.file, lenBuf[:])
+		if err == io.EOF || (err == io.ErrUnexpectedEOF && n == 0) {
+			break
+		}
+		if err != nil {
+			replayErr = errors.Trace(err)
+			break
+		}
+
+		size := binary.BigEndian.Uint32(lenBuf[:])
+		data := make([]byte, size)
+		if _, err := io.ReadFull(s.file, data); err != nil {
+			replayErr = errors.Trace(err)
+			break
+		}
+
+		bl := &binlog.Binlog{}
+		if err := bl.Unmarshal(data); err != nil {
+			replayErr = errors.Trace(err)
+			break
+		}
+		if err := sink.WriteBinlog(bl); err != nil {
+			replayErr = errors.Trace(err)
+			break
+		}
+
+		replayed++
+		offset += int64(len(lenBuf)) + int64(size)
+	}
+
+	if replayed == 0 {
+		return replayErr
+	}
+	if err := s.compact(offset); err != nil {
+		return errors.Trace(err)
+	}
+	atomic.AddInt64(&s.lagRows, -int64(replayed))
+	metrics.BinlogSpoolLagGauge.Set(float64(atomic.LoadInt64(&s.lagRows)))
+	return replayErr
+}
+
+// compact drops the first replayedBytes of the spool file, which have all
+// been durably written to sink.
+func (s *spool) compact(replayedBytes int64) error {
+	path := s.file.Name()
+	if err := s.file.Close(); err != nil {
+		return errors.Trace(err)
+	}
+
+	old, err := os.Open(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer old.Close()
+	if _, err := old.Seek(replayedBytes, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+
+	tmpPath := path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := io.Copy(tmp, old); err != nil {
+		tmp.Close()
+		return errors.Trace(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.Trace(err)
+	}
+
+	s.file, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0640)
+	return errors.Trace(err)
+}
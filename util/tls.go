@@ -0,0 +1,54 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/pingcap/errors"
+)
+
+// ToTLSConfig generates a *tls.Config from the given CA, cert and key paths,
+// for components (e.g. the binlog Kafka/Pulsar sinks) that take their TLS
+// material as file paths rather than a pre-built *tls.Config.
+func ToTLSConfig(caPath, certPath, keyPath string) (*tls.Config, error) {
+	if certPath == "" && keyPath == "" && caPath == "" {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{}
+	if certPath != "" || keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if caPath != "" {
+		caData, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, errors.Errorf("failed to parse CA certificate %s", caPath)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	return tlsCfg, nil
+}